@@ -0,0 +1,259 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/golang-jwt/jwt"
+	ibmcloudproviderv1 "github.com/openshift/machine-api-provider-ibmcloud/pkg/apis/ibmcloudprovider/v1"
+)
+
+// vpcInstanceIdentityTokenURL is the VPC instance metadata service endpoint
+// that hands out a VPC instance identity token scoped to the calling
+// instance's own identity. That token is not an IAM token itself; it must be
+// exchanged for one via vpcInstanceIAMTokenURL.
+const vpcInstanceIdentityTokenURL = "http://169.254.169.254/instance_identity/v1/token?version=2022-03-01"
+
+// vpcInstanceIAMTokenURL is the VPC instance metadata service endpoint that
+// exchanges a VPC instance identity token (see vpcInstanceIdentityTokenURL)
+// for an IAM access token.
+const vpcInstanceIAMTokenURL = "http://169.254.169.254/instance_identity/v1/iam_token?version=2022-03-01"
+
+// tokenRequester is implemented by every IAM-derived authenticator
+// (core.IamAuthenticator, core.ContainerAuthenticator, and
+// vpcInstanceIdentityAuthenticator below) and lets NewClient extract the
+// account ID from the resulting access token regardless of which
+// AuthenticatorFactory produced it.
+type tokenRequester interface {
+	RequestToken() (*core.IamTokenServerResponse, error)
+}
+
+// AuthenticatorFactory builds the core.Authenticator NewClient should use,
+// given the raw credential value from the provider's secret and the rest of
+// the provider spec. Implementations let the machine controller authenticate
+// without a long-lived API key when running on IBM Cloud VPC or IKS with
+// workload identity.
+type AuthenticatorFactory interface {
+	NewAuthenticator(credentialVal string, providerSpec ibmcloudproviderv1.IBMCloudMachineProviderSpec) (core.Authenticator, error)
+}
+
+// authenticatorFactoryFor selects the AuthenticatorFactory for the
+// credentials type on providerSpec, defaulting to a plain API key when
+// unset.
+func authenticatorFactoryFor(credentialsType ibmcloudproviderv1.CredentialsType) AuthenticatorFactory {
+	switch credentialsType {
+	case ibmcloudproviderv1.CredentialsTypeTrustedProfile:
+		return trustedProfileAuthenticatorFactory{}
+	case ibmcloudproviderv1.CredentialsTypeInstanceIdentity:
+		return instanceIdentityAuthenticatorFactory{}
+	case ibmcloudproviderv1.CredentialsTypeFile:
+		return fileCredentialsAuthenticatorFactory{}
+	default:
+		return apiKeyAuthenticatorFactory{}
+	}
+}
+
+// apiKeyAuthenticatorFactory builds an IAM authenticator from a static API
+// key, the long-standing default.
+type apiKeyAuthenticatorFactory struct{}
+
+func (apiKeyAuthenticatorFactory) NewAuthenticator(credentialVal string, _ ibmcloudproviderv1.IBMCloudMachineProviderSpec) (core.Authenticator, error) {
+	return &core.IamAuthenticator{ApiKey: credentialVal}, nil
+}
+
+// trustedProfileAuthenticatorFactory exchanges a projected Kubernetes
+// service-account token for IAM credentials via an IAM trusted profile.
+// credentialVal is the path to the projected token file.
+type trustedProfileAuthenticatorFactory struct{}
+
+func (trustedProfileAuthenticatorFactory) NewAuthenticator(credentialVal string, providerSpec ibmcloudproviderv1.IBMCloudMachineProviderSpec) (core.Authenticator, error) {
+	if providerSpec.Credentials.TrustedProfileID == "" {
+		return nil, fmt.Errorf("credentials.trustedProfileID must be set for the TrustedProfile credentials type")
+	}
+
+	return &core.ContainerAuthenticator{
+		IAMProfileID:    providerSpec.Credentials.TrustedProfileID,
+		CRTokenFilename: credentialVal,
+	}, nil
+}
+
+// fileCredentialsAuthenticatorFactory reads a static IAM API key from a
+// file mounted on disk, for environments that hand the machine controller
+// credentials as a file rather than a secret value.
+type fileCredentialsAuthenticatorFactory struct{}
+
+func (fileCredentialsAuthenticatorFactory) NewAuthenticator(credentialVal string, _ ibmcloudproviderv1.IBMCloudMachineProviderSpec) (core.Authenticator, error) {
+	apiKey, err := os.ReadFile(credentialVal)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials file %v: %v", credentialVal, err)
+	}
+
+	return &core.IamAuthenticator{ApiKey: strings.TrimSpace(string(apiKey))}, nil
+}
+
+// instanceIdentityAuthenticatorFactory retrieves an IAM token from the VPC
+// instance metadata service, for the machine controller running on a VPC
+// instance with instance identity enabled.
+type instanceIdentityAuthenticatorFactory struct{}
+
+func (instanceIdentityAuthenticatorFactory) NewAuthenticator(_ string, _ ibmcloudproviderv1.IBMCloudMachineProviderSpec) (core.Authenticator, error) {
+	return &vpcInstanceIdentityAuthenticator{}, nil
+}
+
+// vpcInstanceIdentityAuthenticator fetches an IAM access token from the VPC
+// instance metadata service using the instance's own identity, so the
+// machine controller can run without a long-lived API key when deployed on
+// an IBM Cloud VPC instance.
+type vpcInstanceIdentityAuthenticator struct{}
+
+// AuthenticationType implements core.Authenticator.
+func (a *vpcInstanceIdentityAuthenticator) AuthenticationType() string {
+	return "vpc-instance-identity"
+}
+
+// Validate implements core.Authenticator.
+func (a *vpcInstanceIdentityAuthenticator) Validate() error {
+	return nil
+}
+
+// Authenticate implements core.Authenticator by setting a bearer token
+// retrieved from the instance metadata service on the outgoing request.
+func (a *vpcInstanceIdentityAuthenticator) Authenticate(request *http.Request) error {
+	token, err := a.RequestToken()
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return nil
+}
+
+// accountIDFromAuthenticator requests an IAM token from authenticator and
+// extracts the account ID from its claims. It works for any of the
+// AuthenticatorFactory implementations above, since they all produce an
+// IAM-derived access token via tokenRequester.
+func accountIDFromAuthenticator(authenticator core.Authenticator) (string, error) {
+	requester, ok := authenticator.(tokenRequester)
+	if !ok {
+		return "", fmt.Errorf("authenticator %T cannot be used to derive an account id", authenticator)
+	}
+
+	iamToken, err := requester.RequestToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Parse access token retrieved from IAM.
+	// Ignore "no Keyfunc was provided" error - we only want to extract the account id.
+	// The token will not be used to perform any further actions.
+	token, _ := jwt.Parse(iamToken.AccessToken, nil)
+
+	var accountID string
+	if claimsObj, ok := token.Claims.(jwt.MapClaims); ok {
+		if accountObj, ok := claimsObj["account"].(map[string]interface{}); ok {
+			if bss, ok := accountObj["bss"].(string); ok {
+				accountID = bss
+			}
+		}
+	}
+
+	if accountID == "" {
+		return "", fmt.Errorf("could not parse account id from token")
+	}
+
+	return accountID, nil
+}
+
+// RequestToken retrieves an IAM access token scoped to this instance's
+// identity from the VPC instance metadata service. This is a two-step
+// exchange: first a VPC instance identity token is fetched, then that token
+// is exchanged for the IAM access token the rest of the client expects.
+func (a *vpcInstanceIdentityAuthenticator) RequestToken() (*core.IamTokenServerResponse, error) {
+	identityToken, err := requestVPCInstanceIdentityToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return requestIAMTokenFromIdentityToken(identityToken)
+}
+
+// requestVPCInstanceIdentityToken fetches a VPC instance identity token from
+// the instance metadata service. The token identifies the instance itself
+// and is not an IAM access token.
+func requestVPCInstanceIdentityToken() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, vpcInstanceIdentityTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "ibm")
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not reach vpc instance metadata service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vpc instance metadata service returned status %v", resp.StatusCode)
+	}
+
+	var identity struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return "", fmt.Errorf("could not decode vpc instance identity token: %v", err)
+	}
+
+	return identity.AccessToken, nil
+}
+
+// requestIAMTokenFromIdentityToken exchanges a VPC instance identity token
+// for an IAM access token via the instance metadata service.
+func requestIAMTokenFromIdentityToken(identityToken string) (*core.IamTokenServerResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, vpcInstanceIAMTokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+identityToken)
+	req.Header.Set("Metadata-Flavor", "ibm")
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach vpc instance metadata service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vpc instance metadata service returned status %v", resp.StatusCode)
+	}
+
+	var token core.IamTokenServerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("could not decode vpc instance iam token: %v", err)
+	}
+
+	return &token, nil
+}
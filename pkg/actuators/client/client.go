@@ -17,17 +17,44 @@ limitations under the License.
 package client
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globalsearchv2"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
 	"github.com/IBM/platform-services-go-sdk/resourcemanagerv2"
 	"github.com/IBM/vpc-go-sdk/vpcv1"
-	"github.com/golang-jwt/jwt"
 	"github.com/openshift/machine-api-operator/pkg/controller/machine"
 	ibmcloudproviderv1 "github.com/openshift/machine-api-provider-ibmcloud/pkg/apis/ibmcloudprovider/v1"
+	"github.com/openshift/machine-api-provider-ibmcloud/pkg/resolver"
 	"github.com/pkg/errors"
 )
 
+// pollInterval is how often InstanceCreate polls while waiting for an
+// instance to reach running.
+const pollInterval = 10 * time.Second
+
+// pollTimeout bounds how long InstanceCreate will wait for an instance to
+// reach running, and how long EnsureCustomImage's image import is allowed
+// to take (measured from the image's own creation time), before giving up
+// so a stalled COS import or instance provision fails the reconcile instead
+// of hanging it forever.
+const pollTimeout = 30 * time.Minute
+
+// resolverCacheTTL bounds how long a resolved resource ID is trusted before
+// a lookup is repeated.
+const resolverCacheTTL = 5 * time.Minute
+
+// sharedResolverCache is shared by every ibmCloudClient so that many
+// concurrent machine creations for the same MachineSet - which resolve the
+// same VPC, subnet, and security group names - perform one lookup each
+// instead of one per machine.
+var sharedResolverCache = resolver.NewCache(resolverCacheTTL)
+
 // instance not found error
 var errInstanceNotFound = errors.New("instance not found")
 
@@ -38,25 +65,38 @@ type Client interface {
 	InstanceExistsByName(name string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec) (bool, error)
 	InstanceGetByName(name string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec) (*vpcv1.Instance, error)
 	InstanceDeleteByName(name string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec) error
-	InstanceCreate(machineName string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec, userData string) (*vpcv1.Instance, error)
+	InstanceCreate(ctx context.Context, machineName string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec, userData string) (*vpcv1.Instance, error)
 	InstanceGetProfile(profileName string) (bool, error)
 
 	// Helper functions
 	GetAccountID() (string, error)
-	GetCustomImageByName(imageName string, resourceGroupID string) (string, error)
+	GetCustomImageByName(imageName string, region string, resourceGroupID string) (string, error)
+	EnsureCustomImage(spec *ibmcloudproviderv1.CustomImageSpec, region string, resourceGroupID string) (string, error)
 	VerifyInstanceProfile(profile string) (string, error)
-	GetVPCIDByName(vpcName string, resourceGroupID string) (string, error)
+	GetVPCIDByName(vpcRef string, region string, resourceGroupID string) (string, error)
 	GetResourceGroupIDByName(resourceGroupName string) (string, error)
-	GetSubnetIDbyName(subnetName string, resourceGroupID string) (string, error)
-	GetSecurityGroupsByName(securityGroupNames []string, resourceGroupID string, vpcID string) ([]vpcv1.SecurityGroupIdentityIntf, error)
-	GetDedicatedHostByName(dedicatedHostName string, resourceGroupID string, zoneName string) (string, error)
+	GetSubnetIDbyName(subnetRef string, region string, resourceGroupID string, vpcID string, zoneName string) (string, error)
+	GetSecurityGroupsByName(securityGroupRefs []string, region string, resourceGroupID string, vpcID string) ([]vpcv1.SecurityGroupIdentityIntf, error)
+	GetDedicatedHostByName(dedicatedHostName string, region string, resourceGroupID string, zoneName string) (string, error)
+	GetDedicatedHostGroupByName(dedicatedHostGroupName string, region string, resourceGroupID string, zoneName string) (string, error)
+	GetPlacementGroupByName(placementGroupName string, region string, resourceGroupID string) (string, error)
+	EnsureReservedIP(subnetID string, ref string) (string, error)
+	ReleaseReservedIP(subnetID string, address string) error
+	EnsureFloatingIP(name string, zoneName string, targetID string) (*vpcv1.FloatingIP, error)
+	DeleteFloatingIP(floatingIPID string) error
+	ListInstancesByTag(tag string) ([]vpcv1.Instance, error)
+	InvalidateCache(kind string, name string)
 }
 
 // ibmCloudClient makes call to IBM Cloud APIs
 type ibmCloudClient struct {
 	AccountID              string
+	Authenticator          core.Authenticator
 	vpcService             *vpcv1.VpcV1
 	resourceManagerService *resourcemanagerv2.ResourceManagerV2
+	globalTaggingService   *globaltaggingv1.GlobalTaggingV1
+	globalSearchService    *globalsearchv2.GlobalSearchV2
+	resolverCache          *resolver.Cache
 }
 
 // IbmcloudClientBuilderFuncType is function type for building ibm cloud client
@@ -65,38 +105,16 @@ type IbmcloudClientBuilderFuncType func(credentialVal string, providerSpec ibmcl
 // NewClient initilizes a new validated client
 func NewClient(credentialVal string, providerSpec ibmcloudproviderv1.IBMCloudMachineProviderSpec) (Client, error) {
 
-	// Authenticator
-	authenticator := &core.IamAuthenticator{
-		ApiKey: credentialVal,
-	}
-
-	// Retrieve IAM Token
-	iamToken, err := authenticator.RequestToken()
+	// Authenticator - selected by providerSpec.Credentials.Type, defaulting
+	// to a plain API key so existing secrets keep working unchanged.
+	authenticator, err := authenticatorFactoryFor(providerSpec.Credentials.Type).NewAuthenticator(credentialVal, providerSpec)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse access token retrieved from IAM
-	// Ignore "no Keyfunc was provided" error - we only want to extract the account id
-	// The token will not be used to perform any further actions
-	token, _ := jwt.Parse(iamToken.AccessToken, nil)
-
-	// Extract account ID
-	var accountID string
-	if claimsObj, ok := token.Claims.(jwt.MapClaims); ok {
-		// Check if account key is present
-		if accountObj, ok := claimsObj["account"].(map[string]interface{}); ok {
-			// Check if bss key is present
-			if bss, ok := accountObj["bss"].(string); ok {
-				// set accountID
-				accountID = bss
-			}
-		}
-	}
-
-	// Check accountID
-	if accountID == "" {
-		return nil, fmt.Errorf("could not parse account id from token")
+	accountID, err := accountIDFromAuthenticator(authenticator)
+	if err != nil {
+		return nil, err
 	}
 
 	// IC Virtual Private Cloud (VPC) API
@@ -115,6 +133,23 @@ func NewClient(credentialVal string, providerSpec ibmcloudproviderv1.IBMCloudMac
 		return nil, err
 	}
 
+	// IC Global Tagging API
+	globalTaggingService, err := globaltaggingv1.NewGlobalTaggingV1(&globaltaggingv1.GlobalTaggingV1Options{
+		Authenticator: authenticator,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// IC Global Search API, used to find every resource attached with a given
+	// tag without an N+1 ListTags call per candidate resource.
+	globalSearchService, err := globalsearchv2.NewGlobalSearchV2(&globalsearchv2.GlobalSearchV2Options{
+		Authenticator: authenticator,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// Get Region and Set Service URL
 	regionName := providerSpec.Region
 	region, _, err := vpcService.GetRegion(vpcService.NewGetRegionOptions(regionName))
@@ -130,11 +165,23 @@ func NewClient(credentialVal string, providerSpec ibmcloudproviderv1.IBMCloudMac
 
 	return &ibmCloudClient{
 		AccountID:              accountID,
+		Authenticator:          authenticator,
 		vpcService:             vpcService,
 		resourceManagerService: resourceManagerService,
+		globalTaggingService:   globalTaggingService,
+		globalSearchService:    globalSearchService,
+		resolverCache:          sharedResolverCache,
 	}, nil
 }
 
+// InvalidateCache evicts every cached resolution for the given resource
+// kind ("vpc", "subnet", "securityGroup", "resourceGroup", "dedicatedHost",
+// ...) and name, so the actuator can force a fresh lookup after a 404 or
+// 409 against a previously resolved ID.
+func (c *ibmCloudClient) InvalidateCache(kind string, name string) {
+	c.resolverCache.InvalidateByName(kind, name)
+}
+
 // InstanceExistsByName checks if the instance exist in VPC
 func (c *ibmCloudClient) InstanceExistsByName(name string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec) (bool, error) {
 	// Get Instance info
@@ -168,6 +215,13 @@ func (c *ibmCloudClient) InstanceDeleteByName(name string, machineProviderConfig
 		return fmt.Errorf("could not get the instance id")
 	}
 
+	// Release any floating IPs bound to the instance's network interfaces
+	// first; unlike a reserved IP, a floating IP is a standalone resource
+	// that VPC does not remove along with the instance.
+	if err := c.releaseInstanceFloatingIPs(instanceID, getInstance); err != nil {
+		return err
+	}
+
 	// Initialize New Delete Instance Options
 	deleteInstanceOption := c.vpcService.NewDeleteInstanceOptions(instanceID)
 	// // Set Instance ID
@@ -182,6 +236,40 @@ func (c *ibmCloudClient) InstanceDeleteByName(name string, machineProviderConfig
 	return nil
 }
 
+// releaseInstanceFloatingIPs deletes every floating IP attached to one of
+// instance's network interfaces. Reserved IPs need no equivalent cleanup
+// here: EnsureReservedIP marks the ones it creates AutoDelete, so VPC
+// removes them along with the network interface, and a BYON reserved IP the
+// caller already owned is left alone.
+func (c *ibmCloudClient) releaseInstanceFloatingIPs(instanceID string, instance *vpcv1.Instance) error {
+	networkInterfaceIDs := []string{}
+	if instance.PrimaryNetworkInterface != nil {
+		networkInterfaceIDs = append(networkInterfaceIDs, *instance.PrimaryNetworkInterface.ID)
+	}
+	for _, networkInterface := range instance.NetworkInterfaces {
+		networkInterfaceIDs = append(networkInterfaceIDs, *networkInterface.ID)
+	}
+
+	for _, networkInterfaceID := range networkInterfaceIDs {
+		listOptions := c.vpcService.NewListInstanceNetworkInterfaceFloatingIpsOptions(instanceID, networkInterfaceID)
+		floatingIPs, _, err := c.vpcService.ListInstanceNetworkInterfaceFloatingIps(listOptions)
+		if err != nil {
+			return fmt.Errorf("could not list floating ips on network interface %v: %v", networkInterfaceID, err)
+		}
+		if floatingIPs == nil {
+			continue
+		}
+
+		for _, floatingIP := range floatingIPs.FloatingIps {
+			if err := c.DeleteFloatingIP(*floatingIP.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // InstanceGetByName retrieves a single instance specified by Instance Name
 func (c *ibmCloudClient) InstanceGetByName(name string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec) (*vpcv1.Instance, error) {
 	// Region Name
@@ -250,8 +338,10 @@ func (c *ibmCloudClient) InstanceGetProfile(profileName string) (bool, error) {
 	return true, nil
 }
 
-// InstanceCreate creates an instance in VPC
-func (c *ibmCloudClient) InstanceCreate(machineName string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec, userData string) (*vpcv1.Instance, error) {
+// InstanceCreate creates an instance in VPC. ctx bounds the wait for the
+// instance to reach running so a caller with a reconcile deadline is not
+// held here for the full pollTimeout before it can requeue.
+func (c *ibmCloudClient) InstanceCreate(ctx context.Context, machineName string, machineProviderConfig *ibmcloudproviderv1.IBMCloudMachineProviderSpec, userData string) (*vpcv1.Instance, error) {
 	// Get Image ID from Image name
 	// Get Subnet ID from Subnet name
 	// Get SecurityGroups ID from Security Groups name
@@ -264,8 +354,14 @@ func (c *ibmCloudClient) InstanceCreate(machineName string, machineProviderConfi
 		return nil, err
 	}
 
-	// Get Custom Image ID
-	imageID, err := c.GetCustomImageByName(machineProviderConfig.Image, resourceGroupID)
+	// Get Custom Image ID, importing it from Cloud Object Storage first if it
+	// has not been pre-created.
+	var imageID string
+	if machineProviderConfig.Image == "" && machineProviderConfig.CustomImage != nil {
+		imageID, err = c.EnsureCustomImage(machineProviderConfig.CustomImage, machineProviderConfig.Region, resourceGroupID)
+	} else {
+		imageID, err = c.GetCustomImageByName(machineProviderConfig.Image, machineProviderConfig.Region, resourceGroupID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -278,43 +374,75 @@ func (c *ibmCloudClient) InstanceCreate(machineName string, machineProviderConfi
 
 	// Get VPC ID
 	vpcName := machineProviderConfig.VPC
-	vpcID, err := c.GetVPCIDByName(vpcName, resourceGroupID)
+	vpcID, err := c.GetVPCIDByName(vpcName, machineProviderConfig.Region, resourceGroupID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get Subnet ID
 	subnetName := machineProviderConfig.PrimaryNetworkInterface.Subnet
-	subnetID, err := c.GetSubnetIDbyName(subnetName, resourceGroupID)
+	subnetID, err := c.GetSubnetIDbyName(subnetName, machineProviderConfig.Region, resourceGroupID, vpcID, machineProviderConfig.Zone)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get Security Groups
-	securityGroups, err := c.GetSecurityGroupsByName(machineProviderConfig.PrimaryNetworkInterface.SecurityGroups, resourceGroupID, vpcID)
+	securityGroups, err := c.GetSecurityGroupsByName(machineProviderConfig.PrimaryNetworkInterface.SecurityGroups, machineProviderConfig.Region, resourceGroupID, vpcID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Reserve (or validate) the primary interface's IP, if one was requested.
+	primaryReservedIPID, err := c.EnsureReservedIP(subnetID, machineProviderConfig.PrimaryNetworkInterface.ReservedIP)
+	if err != nil {
+		return nil, err
+	}
+	primaryNetworkInterface := &vpcv1.NetworkInterfacePrototype{
+		Subnet: &vpcv1.SubnetIdentity{
+			ID: &subnetID,
+		},
+		SecurityGroups: securityGroups,
+	}
+	if primaryReservedIPID != "" {
+		primaryNetworkInterface.PrimaryIP = &vpcv1.NetworkInterfaceIPPrototypeReservedIPIdentity{
+			ID: &primaryReservedIPID,
+		}
+	}
+
 	// Get NetworkInterfaces
 	networkInterfaces := []vpcv1.NetworkInterfacePrototype{}
-	for _, secondaryInterface := range machineProviderConfig.NetworkInterfaces {
+	for i, secondaryInterface := range machineProviderConfig.NetworkInterfaces {
 		secondarySubnetName := secondaryInterface.Subnet
-		secondarySubnetID, err := c.GetSubnetIDbyName(secondarySubnetName, resourceGroupID)
+		secondarySubnetID, err := c.GetSubnetIDbyName(secondarySubnetName, machineProviderConfig.Region, resourceGroupID, vpcID, machineProviderConfig.Zone)
+		if err != nil {
+			return nil, err
+		}
+		secondarySecurityGroups, err := c.GetSecurityGroupsByName(secondaryInterface.SecurityGroups, machineProviderConfig.Region, resourceGroupID, vpcID)
 		if err != nil {
 			return nil, err
 		}
-		secondarySecurityGroups, err := c.GetSecurityGroupsByName(secondaryInterface.SecurityGroups, resourceGroupID, vpcID)
+		secondaryReservedIPID, err := c.EnsureReservedIP(secondarySubnetID, secondaryInterface.ReservedIP)
 		if err != nil {
 			return nil, err
 		}
+		// Name the interface deterministically so it can be matched back up
+		// in the returned instance's NetworkInterfaces later - that slice is
+		// in API-defined order, not config order, so the config index i
+		// cannot be used to find it again.
+		secondaryInterfaceName := secondaryNetworkInterfaceName(machineName, i)
 		networkInterface := vpcv1.NetworkInterfacePrototype{
+			Name: &secondaryInterfaceName,
 			Subnet: &vpcv1.SubnetIdentity{
 				ID: &secondarySubnetID,
 			},
 			SecurityGroups:  secondarySecurityGroups,
 			AllowIPSpoofing: &secondaryInterface.AllowIPSpoofing,
 		}
+		if secondaryReservedIPID != "" {
+			networkInterface.PrimaryIP = &vpcv1.NetworkInterfaceIPPrototypeReservedIPIdentity{
+				ID: &secondaryReservedIPID,
+			}
+		}
 		networkInterfaces = append(networkInterfaces, networkInterface)
 	}
 
@@ -333,27 +461,43 @@ func (c *ibmCloudClient) InstanceCreate(machineName string, machineProviderConfi
 		ResourceGroup: &vpcv1.ResourceGroupIdentity{
 			ID: &resourceGroupID,
 		},
-		PrimaryNetworkInterface: &vpcv1.NetworkInterfacePrototype{
-			Subnet: &vpcv1.SubnetIdentity{
-				ID: &subnetID,
-			},
-			SecurityGroups: securityGroups,
-		},
-		NetworkInterfaces: networkInterfaces,
+		PrimaryNetworkInterface: primaryNetworkInterface,
+		NetworkInterfaces:       networkInterfaces,
 		VPC: &vpcv1.VPCIdentity{
 			ID: &vpcID,
 		},
 		UserData: &userData,
 	}
 
-	// Get Dedicated Host ID if needed
-	if machineProviderConfig.DedicatedHost != "" {
-		dedicatedHostID, err := c.GetDedicatedHostByName(machineProviderConfig.DedicatedHost, resourceGroupID, machineProviderConfig.Zone)
+	// Resolve the instance placement target, if any. DedicatedHost and
+	// PlacementGroup are mutually exclusive ways of influencing where the
+	// instance lands.
+	if machineProviderConfig.DedicatedHost != "" && machineProviderConfig.PlacementGroup != "" {
+		return nil, machine.InvalidMachineConfiguration("only one of dedicatedHost or placementGroup may be set")
+	}
+
+	switch {
+	case machineProviderConfig.DedicatedHost != "":
+		// DedicatedHost may name either a single host or a host group; try
+		// the host first since that was the original, narrower behavior.
+		if dedicatedHostID, err := c.GetDedicatedHostByName(machineProviderConfig.DedicatedHost, machineProviderConfig.Region, resourceGroupID, machineProviderConfig.Zone); err == nil {
+			instancePrototypeObj.PlacementTarget = &vpcv1.InstancePlacementTargetPrototypeDedicatedHostIdentity{
+				ID: &dedicatedHostID,
+			}
+		} else if dedicatedHostGroupID, groupErr := c.GetDedicatedHostGroupByName(machineProviderConfig.DedicatedHost, machineProviderConfig.Region, resourceGroupID, machineProviderConfig.Zone); groupErr == nil {
+			instancePrototypeObj.PlacementTarget = &vpcv1.InstancePlacementTargetPrototypeDedicatedHostGroupIdentity{
+				ID: &dedicatedHostGroupID,
+			}
+		} else {
+			return nil, err
+		}
+	case machineProviderConfig.PlacementGroup != "":
+		placementGroupID, err := c.GetPlacementGroupByName(machineProviderConfig.PlacementGroup, machineProviderConfig.Region, resourceGroupID)
 		if err != nil {
 			return nil, err
 		}
-		instancePrototypeObj.PlacementTarget = &vpcv1.InstancePlacementTargetPrototypeDedicatedHostIdentity{
-			ID: &dedicatedHostID,
+		instancePrototypeObj.PlacementTarget = &vpcv1.InstancePlacementTargetPrototypePlacementGroupIdentity{
+			ID: &placementGroupID,
 		}
 	}
 
@@ -369,32 +513,132 @@ func (c *ibmCloudClient) InstanceCreate(machineName string, machineProviderConfi
 		return nil, err
 	}
 
+	// Attach the user-supplied tags plus the cluster-ownership tag so the
+	// instance can be found again during reconcile via ListInstancesByTag.
+	ownerTag := fmt.Sprintf("kubernetes.io/cluster/%s:owned", machineProviderConfig.InfrastructureID)
+	if err := c.tagResource(*instance.CRN, append(machineProviderConfig.Tags, ownerTag)); err != nil {
+		return nil, fmt.Errorf("could not tag instance %v: %v", machineName, err)
+	}
+
+	// Allocate a floating IP for any interface that asked for one. This has
+	// to wait for the instance to reach running, since its network
+	// interfaces are not reported back with their own IDs until then.
+	needsFloatingIP := machineProviderConfig.PrimaryNetworkInterface.EnableFloatingIP
+	for _, secondaryInterface := range machineProviderConfig.NetworkInterfaces {
+		if secondaryInterface.EnableFloatingIP {
+			needsFloatingIP = true
+			break
+		}
+	}
+
+	if needsFloatingIP {
+		if err := c.waitForInstanceRunning(ctx, *instance.ID); err != nil {
+			return nil, err
+		}
+
+		runningInstance, err := c.InstanceGetByID(*instance.ID)
+		if err != nil {
+			return nil, err
+		}
+		instance = runningInstance
+
+		if machineProviderConfig.PrimaryNetworkInterface.EnableFloatingIP {
+			if _, err := c.EnsureFloatingIP(fmt.Sprintf("%s-fip", machineName), machineProviderConfig.Zone, *instance.PrimaryNetworkInterface.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, secondaryInterface := range machineProviderConfig.NetworkInterfaces {
+			if !secondaryInterface.EnableFloatingIP {
+				continue
+			}
+			secondaryInterfaceName := secondaryNetworkInterfaceName(machineName, i)
+			networkInterfaceID, err := networkInterfaceIDByName(instance, secondaryInterfaceName)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := c.EnsureFloatingIP(fmt.Sprintf("%s-fip-%d", machineName, i), machineProviderConfig.Zone, networkInterfaceID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return instance, nil
 }
 
-// GetVPCIDByName Retrives VPC ID
-func (c *ibmCloudClient) GetVPCIDByName(vpcName string, resourceGroupID string) (string, error) {
-	// Initialize List Vpcs Options
-	vpcOptions := c.vpcService.NewListVpcsOptions()
+// secondaryNetworkInterfaceName derives the deterministic name InstanceCreate
+// gives a secondary network interface at config index i, so the interface
+// can be found again in the instance's reported NetworkInterfaces - which is
+// in API-defined order, not config order - without relying on its index.
+func secondaryNetworkInterfaceName(machineName string, i int) string {
+	return fmt.Sprintf("%s-nic-%d", machineName, i)
+}
 
-	// Set Resource Group ID
-	vpcOptions.SetResourceGroupID(resourceGroupID)
+// networkInterfaceIDByName returns the ID of the network interface named
+// name on instance.
+func networkInterfaceIDByName(instance *vpcv1.Instance, name string) (string, error) {
+	for _, networkInterface := range instance.NetworkInterfaces {
+		if networkInterface.Name != nil && *networkInterface.Name == name {
+			return *networkInterface.ID, nil
+		}
+	}
+	return "", fmt.Errorf("could not find network interface named %v on instance %v", name, *instance.ID)
+}
 
-	// Get a list all VPCs
-	vpcList, _, err := c.vpcService.ListVpcs(vpcOptions)
-	if err != nil {
-		return "", err
+// GetVPCIDByName resolves vpcRef - a VPC name, ID, or CRN - to a VPC ID. When
+// vpcRef is already an ID or CRN it is validated directly against the VPC
+// API instead of listing every VPC in the resource group, which is what
+// lets a BYON install reference a shared VPC the controller has no
+// permission to list.
+func (c *ibmCloudClient) GetVPCIDByName(vpcRef string, region string, resourceGroupID string) (string, error) {
+	switch classifyResourceRef(vpcRef) {
+	case resourceRefID, resourceRefCRN:
+		vpcID := vpcRef
+		if classifyResourceRef(vpcRef) == resourceRefCRN {
+			vpcID = crnResourceID(vpcRef)
+		}
+		vpc, _, err := c.vpcService.GetVPC(c.vpcService.NewGetVPCOptions(vpcID))
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve vpc id of: %v", vpcRef)
+		}
+		return *vpc.ID, nil
 	}
 
-	if vpcList != nil {
-		for _, eachVPC := range vpcList.Vpcs {
-			if *eachVPC.Name == vpcName {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "vpc", Name: vpcRef}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		vpcs, err := resolver.FollowPages(func(start *string) ([]vpcv1.VPC, *string, error) {
+			vpcOptions := c.vpcService.NewListVpcsOptions()
+			vpcOptions.SetResourceGroupID(resourceGroupID)
+			if start != nil {
+				vpcOptions.SetStart(*start)
+			}
+
+			vpcList, _, err := c.vpcService.ListVpcs(vpcOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			if vpcList == nil {
+				return nil, nil, nil
+			}
+
+			var next *string
+			if vpcList.Next != nil {
+				next = vpcList.Next.Href
+			}
+			return vpcList.Vpcs, next, nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, eachVPC := range vpcs {
+			if *eachVPC.Name == vpcRef {
 				return *eachVPC.ID, nil
 			}
 		}
-	}
 
-	return "", fmt.Errorf("could not retrieve vpc id of name: %v", vpcName)
+		return "", fmt.Errorf("could not retrieve vpc id of name: %v", vpcRef)
+	})
 }
 
 // GetAccountID retrieves the Account ID for the IBMCloud Client
@@ -406,166 +650,744 @@ func (c *ibmCloudClient) GetAccountID() (string, error) {
 }
 
 // GetCustomImageByName retrieves custom image from VPC by region and name
-func (c *ibmCloudClient) GetCustomImageByName(imageName string, resourceGroupID string) (string, error) {
-	// Initialize List Images Options
-	listImagesOptions := c.vpcService.NewListImagesOptions()
+func (c *ibmCloudClient) GetCustomImageByName(imageName string, region string, resourceGroupID string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "image", Name: imageName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		// Initialize List Images Options
+		listImagesOptions := c.vpcService.NewListImagesOptions()
+
+		// Private images
+		listImagesOptions.SetVisibility(vpcv1.ImageVisibilityPrivateConst)
+		// Set Resource Group ID
+		listImagesOptions.SetResourceGroupID(resourceGroupID)
+		// Set Image name
+		listImagesOptions.SetName(imageName)
+
+		// List of all the private images in a region
+		privateImage, _, err := c.vpcService.ListImages(listImagesOptions)
+		if err != nil {
+			return "", err
+		}
+
+		if privateImage != nil && len(privateImage.Images) != 0 {
+			// Return Image ID
+			return *privateImage.Images[0].ID, nil
+		}
+
+		return "", fmt.Errorf("could not retrieve image id of name: %v", imageName)
+	})
+}
+
+// EnsureCustomImage imports a VPC Custom Image from a Cloud Object Storage
+// object, tags it, and returns its ID once it has reached the "available"
+// status; while the import is still in progress it returns an error (see
+// waitForImageAvailable) so the caller retries. If an image named spec.Name
+// already exists in the resource group it is reused instead of importing a
+// new one, subject to the same status check. This is used from
+// InstanceCreate to bootstrap machines in environments where the target
+// image has not been pre-imported.
+func (c *ibmCloudClient) EnsureCustomImage(spec *ibmcloudproviderv1.CustomImageSpec, region string, resourceGroupID string) (string, error) {
+	if imageID, err := c.GetCustomImageByName(spec.Name, region, resourceGroupID); err == nil {
+		if err := c.waitForImageAvailable(imageID); err != nil {
+			return "", err
+		}
+		return imageID, nil
+	}
 
-	// Private images
-	listImagesOptions.SetVisibility(vpcv1.ImageVisibilityPrivateConst)
-	// Set Resource Group ID
-	listImagesOptions.SetResourceGroupID(resourceGroupID)
-	// Set Image name
-	listImagesOptions.SetName(imageName)
+	imagePrototype := &vpcv1.ImagePrototypeImageByFile{
+		Name: &spec.Name,
+		ResourceGroup: &vpcv1.ResourceGroupIdentity{
+			ID: &resourceGroupID,
+		},
+		File: &vpcv1.ImageFilePrototype{
+			Href: &spec.COSObjectURL,
+		},
+		OperatingSystem: &vpcv1.OperatingSystemIdentity{
+			Name: &spec.OperatingSystem,
+		},
+	}
+	if spec.EncryptionKeyCRN != "" {
+		imagePrototype.EncryptionKey = &vpcv1.EncryptionKeyIdentity{
+			CRN: &spec.EncryptionKeyCRN,
+		}
+	}
 
-	// List of all the private images in a region
-	privateImage, _, err := c.vpcService.ListImages(listImagesOptions)
+	createImageOptions := c.vpcService.NewCreateImageOptions(imagePrototype)
+	image, _, err := c.vpcService.CreateImage(createImageOptions)
 	if err != nil {
+		return "", fmt.Errorf("could not import custom image %v from %v: %v", spec.Name, spec.COSObjectURL, err)
+	}
+
+	// Tag the image as soon as it exists: a later retry finds it by name and
+	// reuses it, so this is the only call that tags it.
+	if err := c.tagResource(*image.CRN, []string{fmt.Sprintf("name:%s", spec.Name)}); err != nil {
+		return "", fmt.Errorf("could not tag custom image %v: %v", spec.Name, err)
+	}
+
+	imageID := *image.ID
+	if err := c.waitForImageAvailable(imageID); err != nil {
 		return "", err
 	}
 
-	if privateImage != nil && len(privateImage.Images) != 0 {
-		// Return Image ID
-		return *privateImage.Images[0].ID, nil
+	return imageID, nil
+}
+
+// waitForImageAvailable checks whether the image has reached the
+// "available" status or a terminal failure status, and otherwise returns a
+// plain error so EnsureCustomImage's caller requeues through the normal
+// reconcile backoff instead of this call blocking a reconcile worker for up
+// to pollTimeout. Because no state is kept across separate reconcile
+// attempts, the overall wait is bounded by pollTimeout measured from the
+// image's own creation time rather than from an in-process deadline.
+func (c *ibmCloudClient) waitForImageAvailable(imageID string) error {
+	image, _, err := c.vpcService.GetImage(c.vpcService.NewGetImageOptions(imageID))
+	if err != nil {
+		return err
 	}
 
-	return "", fmt.Errorf("could not retrieve image id of name: %v", imageName)
+	switch *image.Status {
+	case vpcv1.ImageStatusAvailableConst:
+		return nil
+	case vpcv1.ImageStatusFailedConst:
+		return fmt.Errorf("custom image %v failed to import", imageID)
+	}
+
+	if image.CreatedAt != nil && time.Since(time.Time(*image.CreatedAt)) > pollTimeout {
+		return fmt.Errorf("timed out after %v waiting for custom image %v to become available", pollTimeout, imageID)
+	}
+
+	return fmt.Errorf("custom image %v is still importing", imageID)
 }
 
-// VerifyInstanceProfile verifies the provided instance profile exists
-func (c *ibmCloudClient) VerifyInstanceProfile(profileName string) (string, error) {
-	// Get list of instance profiles
-	instanceProfilesList, _, err := c.vpcService.ListInstanceProfiles(c.vpcService.NewListInstanceProfilesOptions())
+// tagResource attaches tags to a resource identified by its CRN using the
+// IBM Cloud Global Tagging service.
+func (c *ibmCloudClient) tagResource(resourceCRN string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	attachTagOptions := c.globalTaggingService.NewAttachTagOptions([]globaltaggingv1.Resource{
+		{ResourceID: &resourceCRN},
+	})
+	attachTagOptions.SetTagNames(tags)
+
+	_, _, err := c.globalTaggingService.AttachTag(attachTagOptions)
+	return err
+}
+
+// ListInstancesByTag returns the VPC instances that have tag attached, so
+// the actuator can locate orphaned machines during reconcile without
+// relying solely on name lookups. It resolves the tagged CRNs with a single
+// Global Search query rather than a ListTags call per candidate instance,
+// and drains every page of both the search results and the instance list
+// instead of truncating at the default page size.
+func (c *ibmCloudClient) ListInstancesByTag(tag string) ([]vpcv1.Instance, error) {
+	taggedCRNs, err := c.crnsByTag(tag)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if len(taggedCRNs) == 0 {
+		return nil, nil
+	}
+
+	instances, err := resolver.FollowPages(func(start *string) ([]vpcv1.Instance, *string, error) {
+		listInstOptions := c.vpcService.NewListInstancesOptions()
+		if start != nil {
+			listInstOptions.SetStart(*start)
+		}
+
+		instanceList, _, err := c.vpcService.ListInstances(listInstOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instanceList == nil {
+			return nil, nil, nil
+		}
+
+		var next *string
+		if instanceList.Next != nil {
+			next = instanceList.Next.Href
+		}
+		return instanceList.Instances, next, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged []vpcv1.Instance
+	for _, instance := range instances {
+		if taggedCRNs[*instance.CRN] {
+			tagged = append(tagged, instance)
+		}
+	}
+
+	return tagged, nil
+}
+
+// crnsByTag returns the set of resource CRNs attached with tag, using the
+// Global Search API's tag query instead of a ListTags call per candidate
+// resource.
+func (c *ibmCloudClient) crnsByTag(tag string) (map[string]bool, error) {
+	query := fmt.Sprintf("tags:%q", tag)
+
+	crns := map[string]bool{}
+	var cursor *string
+	for {
+		searchOptions := c.globalSearchService.NewSearchOptions(query)
+		searchOptions.SetFields([]string{"crn"})
+		if cursor != nil {
+			searchOptions.SetSearchCursor(*cursor)
+		}
+
+		result, _, err := c.globalSearchService.Search(searchOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not search for resources tagged %v: %v", tag, err)
+		}
+		if result == nil {
+			return crns, nil
+		}
+
+		for _, item := range result.Items {
+			if item.CRN != nil {
+				crns[*item.CRN] = true
+			}
+		}
+
+		if result.SearchCursor == nil || *result.SearchCursor == "" {
+			return crns, nil
+		}
+		cursor = result.SearchCursor
 	}
+}
+
+// VerifyInstanceProfile verifies the provided instance profile exists
+func (c *ibmCloudClient) VerifyInstanceProfile(profileName string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Kind: "instanceProfile", Name: profileName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		// Get list of instance profiles
+		instanceProfilesList, _, err := c.vpcService.ListInstanceProfiles(c.vpcService.NewListInstanceProfilesOptions())
+		if err != nil {
+			return "", err
+		}
+
+		if instanceProfilesList == nil {
+			return "", fmt.Errorf("no instance profiles found")
+		}
 
-	if instanceProfilesList != nil {
 		for _, instanceProfile := range instanceProfilesList.Profiles {
 			if *instanceProfile.Name == profileName {
 				return profileName, nil
 			}
 		}
 		return "", machine.InvalidMachineConfiguration(fmt.Sprintf("could not find instance profile: %v", profileName))
-	}
-	return "", fmt.Errorf("no instance profiles found")
+	})
 }
 
 // GetResourceGroupIDByName retrives a Resource Group ID
 func (c *ibmCloudClient) GetResourceGroupIDByName(resourceGroupName string) (string, error) {
-	// Initialize New List Resource Group Options
-	resourceGroupOptions := c.resourceManagerService.NewListResourceGroupsOptions()
-	// Set Resource Group Name
-	resourceGroupOptions.SetName(resourceGroupName)
-	// Set Account ID
-	resourceGroupOptions.SetAccountID(c.AccountID)
-	// Get Resource Group
-	resourceGroup, _, err := c.resourceManagerService.ListResourceGroups(resourceGroupOptions)
-	if err != nil {
-		return "", err
-	}
+	cacheKey := resolver.Key{AccountID: c.AccountID, Kind: "resourceGroup", Name: resourceGroupName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		// Initialize New List Resource Group Options
+		resourceGroupOptions := c.resourceManagerService.NewListResourceGroupsOptions()
+		// Set Resource Group Name
+		resourceGroupOptions.SetName(resourceGroupName)
+		// Set Account ID
+		resourceGroupOptions.SetAccountID(c.AccountID)
+		// Get Resource Group
+		resourceGroup, _, err := c.resourceManagerService.ListResourceGroups(resourceGroupOptions)
+		if err != nil {
+			return "", err
+		}
 
-	// Check resourceGroup is not nil and Resources[] is not empty
-	if resourceGroup != nil && len(resourceGroup.Resources) != 0 {
-		// Return Resource Group ID
-		return *resourceGroup.Resources[0].ID, nil
-	}
+		// Check resourceGroup is not nil and Resources[] is not empty
+		if resourceGroup != nil && len(resourceGroup.Resources) != 0 {
+			// Return Resource Group ID
+			return *resourceGroup.Resources[0].ID, nil
+		}
 
-	return "", fmt.Errorf("could not retrieve resource group id of name: %v", resourceGroupName)
+		return "", fmt.Errorf("could not retrieve resource group id of name: %v", resourceGroupName)
+	})
 }
 
-// GetSubnetIDbyName retrives a Subnet ID
-func (c *ibmCloudClient) GetSubnetIDbyName(subnetName string, resourceGroupID string) (string, error) {
-	// Initialize List Subnets Options
-	subnetOption := c.vpcService.NewListSubnetsOptions()
+// GetSubnetIDbyName resolves subnetRef - a subnet name, ID, or CRN - to a
+// subnet ID and validates that the subnet actually lives in zoneName and
+// belongs to vpcID. The validation guards against a BYON machine silently
+// attaching to a subnet from the wrong network: when an ID/CRN is given we
+// never list the account's subnets, so nothing else would catch the
+// mismatch.
+func (c *ibmCloudClient) GetSubnetIDbyName(subnetRef string, region string, resourceGroupID string, vpcID string, zoneName string) (string, error) {
+	var subnet *vpcv1.Subnet
+
+	switch classifyResourceRef(subnetRef) {
+	case resourceRefID, resourceRefCRN:
+		subnetID := subnetRef
+		if classifyResourceRef(subnetRef) == resourceRefCRN {
+			subnetID = crnResourceID(subnetRef)
+		}
+		s, _, err := c.vpcService.GetSubnet(c.vpcService.NewGetSubnetOptions(subnetID))
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve subnet id of: %v", subnetRef)
+		}
+		subnet = s
+	default:
+		cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "subnet", Name: subnetRef}
+		subnetID, err := c.resolverCache.Resolve(cacheKey, func() (string, error) {
+			subnets, err := resolver.FollowPages(func(start *string) ([]vpcv1.Subnet, *string, error) {
+				subnetOption := c.vpcService.NewListSubnetsOptions()
+				subnetOption.SetResourceGroupID(resourceGroupID)
+				if start != nil {
+					subnetOption.SetStart(*start)
+				}
+
+				subnetList, _, err := c.vpcService.ListSubnets(subnetOption)
+				if err != nil {
+					return nil, nil, err
+				}
+				if subnetList == nil {
+					return nil, nil, nil
+				}
+
+				var next *string
+				if subnetList.Next != nil {
+					next = subnetList.Next.Href
+				}
+				return subnetList.Subnets, next, nil
+			})
+			if err != nil {
+				return "", err
+			}
 
-	// Set Resource Group ID
-	subnetOption.SetResourceGroupID(resourceGroupID)
+			for _, eachSubnet := range subnets {
+				if *eachSubnet.Name == subnetRef {
+					return *eachSubnet.ID, nil
+				}
+			}
 
-	// Get a list of all subnets
-	subnetList, _, err := c.vpcService.ListSubnets(subnetOption)
-	if err != nil {
-		return "", err
+			return "", fmt.Errorf("could not retrieve subnet id of name: %v", subnetRef)
+		})
+		if err != nil {
+			return "", err
+		}
+
+		s, _, err := c.vpcService.GetSubnet(c.vpcService.NewGetSubnetOptions(subnetID))
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve subnet id of: %v", subnetRef)
+		}
+		subnet = s
+	}
+
+	// Make sure the resolved subnet actually sits where the machine expects.
+	if subnet.Zone != nil && subnet.Zone.Name != nil && *subnet.Zone.Name != zoneName {
+		return "", fmt.Errorf("subnet %v is in zone %v, not %v", subnetRef, *subnet.Zone.Name, zoneName)
+	}
+	if subnet.VPC != nil && subnet.VPC.ID != nil && *subnet.VPC.ID != vpcID {
+		return "", fmt.Errorf("subnet %v does not belong to vpc %v", subnetRef, vpcID)
 	}
 
-	if subnetList != nil {
-		for _, eachSubnet := range subnetList.Subnets {
-			if *eachSubnet.Name == subnetName {
-				// Return Subnet ID
-				return *eachSubnet.ID, nil
+	return *subnet.ID, nil
+}
+
+// GetSecurityGroupsByName resolves securityGroupRefs - names, IDs, or CRNs -
+// to security group identities. Entries already expressed as an ID or CRN
+// are used directly; only name references fall back to the list-then-filter
+// lookup, so a BYON install can reference security groups the controller
+// cannot list.
+func (c *ibmCloudClient) GetSecurityGroupsByName(securityGroupRefs []string, region string, resourceGroupID string, vpcID string) ([]vpcv1.SecurityGroupIdentityIntf, error) {
+	var securityGroupIdentityList = make([]vpcv1.SecurityGroupIdentityIntf, 0, len(securityGroupRefs))
+
+	for _, ref := range securityGroupRefs {
+		switch classifyResourceRef(ref) {
+		case resourceRefID:
+			id := ref
+			securityGroupIdentityList = append(securityGroupIdentityList, &vpcv1.SecurityGroupIdentityByID{ID: &id})
+		case resourceRefCRN:
+			id := crnResourceID(ref)
+			securityGroupIdentityList = append(securityGroupIdentityList, &vpcv1.SecurityGroupIdentityByID{ID: &id})
+		default:
+			id, err := c.getSecurityGroupIDByName(ref, region, resourceGroupID, vpcID)
+			if err != nil {
+				return nil, err
 			}
+			securityGroupIdentityList = append(securityGroupIdentityList, &vpcv1.SecurityGroupIdentityByID{ID: &id})
 		}
 	}
-	return "", fmt.Errorf("could not retrieve subnet id of name: %v", subnetName)
+
+	return securityGroupIdentityList, nil
 }
 
-// GetSecurityGroupsByName retrieves Security Groups ID
-func (c *ibmCloudClient) GetSecurityGroupsByName(securityGroupNames []string, resourceGroupID string, vpcID string) ([]vpcv1.SecurityGroupIdentityIntf, error) {
-	// Initialize a map with Security Group Names
-	securityGroupMap := map[string]string{}
-	for _, item := range securityGroupNames {
-		securityGroupMap[item] = ""
-	}
+// getSecurityGroupIDByName resolves a single security group name to its ID,
+// through the resolver cache like every other name lookup in this file, so
+// that many concurrent machine creations resolving the same security group
+// name coalesce into a single ListSecurityGroups call instead of each
+// running their own.
+func (c *ibmCloudClient) getSecurityGroupIDByName(name string, region string, resourceGroupID string, vpcID string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "securityGroup", Name: name}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		// Get every page of Security Groups in the VPC rather than silently
+		// truncating at the default page size.
+		securityGroups, err := resolver.FollowPages(func(start *string) ([]vpcv1.SecurityGroup, *string, error) {
+			securityGroupOptions := c.vpcService.NewListSecurityGroupsOptions()
+			securityGroupOptions.SetResourceGroupID(resourceGroupID)
+			securityGroupOptions.SetVPCID(vpcID)
+			if start != nil {
+				securityGroupOptions.SetStart(*start)
+			}
+
+			securityGroupList, _, err := c.vpcService.ListSecurityGroups(securityGroupOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			if securityGroupList == nil {
+				return nil, nil, nil
+			}
+
+			var next *string
+			if securityGroupList.Next != nil {
+				next = securityGroupList.Next.Href
+			}
+			return securityGroupList.SecurityGroups, next, nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, eachSecurityGroup := range securityGroups {
+			if *eachSecurityGroup.Name == name {
+				return *eachSecurityGroup.ID, nil
+			}
+		}
+
+		return "", fmt.Errorf("could not retrieve security group id of name: %v", name)
+	})
+}
+
+// GetDedicatedHostByName retrieves Dedicated Hosts info
+func (c *ibmCloudClient) GetDedicatedHostByName(dedicatedHostName string, region string, resourceGroupID string, zoneName string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "dedicatedHost", Name: dedicatedHostName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		dedicatedHosts, err := resolver.FollowPages(func(start *string) ([]vpcv1.DedicatedHost, *string, error) {
+			dedicatedHostOptions := c.vpcService.NewListDedicatedHostsOptions()
+			dedicatedHostOptions.SetResourceGroupID(resourceGroupID)
+			dedicatedHostOptions.SetZoneName(zoneName)
+			if start != nil {
+				dedicatedHostOptions.SetStart(*start)
+			}
+
+			dedicatedHostList, _, err := c.vpcService.ListDedicatedHosts(dedicatedHostOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			if dedicatedHostList == nil {
+				return nil, nil, nil
+			}
+
+			var next *string
+			if dedicatedHostList.Next != nil {
+				next = dedicatedHostList.Next.Href
+			}
+			return dedicatedHostList.DedicatedHosts, next, nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, eachDedicatedHost := range dedicatedHosts {
+			if *eachDedicatedHost.Name == dedicatedHostName {
+				// return Dedicated Host ID
+				return *eachDedicatedHost.ID, nil
+			}
+		}
+
+		return "", fmt.Errorf("could not retrieve dedicated host id of name: %v", dedicatedHostName)
+	})
+}
+
+// GetDedicatedHostGroupByName retrieves the ID of a dedicated host group,
+// letting a machine target a group instead of a single host so IBM Cloud
+// can pick the least-loaded host in it.
+func (c *ibmCloudClient) GetDedicatedHostGroupByName(dedicatedHostGroupName string, region string, resourceGroupID string, zoneName string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "dedicatedHostGroup", Name: dedicatedHostGroupName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		dedicatedHostGroups, err := resolver.FollowPages(func(start *string) ([]vpcv1.DedicatedHostGroup, *string, error) {
+			dedicatedHostGroupOptions := c.vpcService.NewListDedicatedHostGroupsOptions()
+			dedicatedHostGroupOptions.SetResourceGroupID(resourceGroupID)
+			dedicatedHostGroupOptions.SetZoneName(zoneName)
+			if start != nil {
+				dedicatedHostGroupOptions.SetStart(*start)
+			}
+
+			dedicatedHostGroupList, _, err := c.vpcService.ListDedicatedHostGroups(dedicatedHostGroupOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			if dedicatedHostGroupList == nil {
+				return nil, nil, nil
+			}
+
+			var next *string
+			if dedicatedHostGroupList.Next != nil {
+				next = dedicatedHostGroupList.Next.Href
+			}
+			return dedicatedHostGroupList.Groups, next, nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, eachGroup := range dedicatedHostGroups {
+			if *eachGroup.Name == dedicatedHostGroupName {
+				return *eachGroup.ID, nil
+			}
+		}
 
-	// Initialize List Security Groups Options
-	securityGroupOptions := c.vpcService.NewListSecurityGroupsOptions()
-	// Set Resource Group ID
-	securityGroupOptions.SetResourceGroupID(resourceGroupID)
-	// Set VPC ID
-	securityGroupOptions.SetVPCID(vpcID)
+		return "", fmt.Errorf("could not retrieve dedicated host group id of name: %v", dedicatedHostGroupName)
+	})
+}
 
-	// Get a List of Security Groups
-	securityGroups, _, _ := c.vpcService.ListSecurityGroups(securityGroupOptions)
+// GetPlacementGroupByName retrieves the ID of a placement group, used to
+// give a machine spread or pack anti-affinity guarantees relative to the
+// group's other instances.
+func (c *ibmCloudClient) GetPlacementGroupByName(placementGroupName string, region string, resourceGroupID string) (string, error) {
+	cacheKey := resolver.Key{AccountID: c.AccountID, Region: region, ResourceGroupID: resourceGroupID, Kind: "placementGroup", Name: placementGroupName}
+	return c.resolverCache.Resolve(cacheKey, func() (string, error) {
+		placementGroups, err := resolver.FollowPages(func(start *string) ([]vpcv1.PlacementGroup, *string, error) {
+			placementGroupOptions := c.vpcService.NewListPlacementGroupsOptions()
+			placementGroupOptions.SetResourceGroupID(resourceGroupID)
+			if start != nil {
+				placementGroupOptions.SetStart(*start)
+			}
 
-	// A slice with 0 len
-	var SecurityGroupIdentityList = make([]vpcv1.SecurityGroupIdentityIntf, 0)
+			placementGroupList, _, err := c.vpcService.ListPlacementGroups(placementGroupOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			if placementGroupList == nil {
+				return nil, nil, nil
+			}
 
-	// Make sure securityGroups is not nil
-	if securityGroups != nil {
-		for _, eachSecurityGroup := range securityGroups.SecurityGroups {
-			if _, ok := securityGroupMap[*eachSecurityGroup.Name]; ok {
-				SecurityGroupIdentityList = append(SecurityGroupIdentityList, &vpcv1.SecurityGroupIdentityByID{
-					ID: eachSecurityGroup.ID,
-				})
-				// Delete ID from map
-				delete(securityGroupMap, *eachSecurityGroup.Name)
+			var next *string
+			if placementGroupList.Next != nil {
+				next = placementGroupList.Next.Href
 			}
+			return placementGroupList.PlacementGroups, next, nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, eachPlacementGroup := range placementGroups {
+			if *eachPlacementGroup.Name == placementGroupName {
+				return *eachPlacementGroup.ID, nil
+			}
+		}
+
+		return "", fmt.Errorf("could not retrieve placement group id of name: %v", placementGroupName)
+	})
+}
+
+// reservedIPName derives a VPC-valid name for a reserved IP created from a
+// bare address, since a reserved IP name must be an RFC1035 label and so
+// cannot contain the dots an IPv4 address does.
+func reservedIPName(address string) string {
+	return fmt.Sprintf("reserved-ip-%s", strings.ReplaceAll(address, ".", "-"))
+}
+
+// EnsureReservedIP resolves ref to the ID of a reserved IP on subnetID. When
+// ref is already the ID of a reserved IP - a BYON install reusing one it
+// created out of band - it is validated directly. Otherwise ref is treated
+// as the literal address to reserve, and a new reserved IP is created with
+// AutoDelete set so VPC removes it along with the network interface that
+// ends up using it. An empty ref is a no-op, since most network interfaces
+// let VPC assign their primary IP automatically.
+func (c *ibmCloudClient) EnsureReservedIP(subnetID string, ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+
+	if net.ParseIP(ref) == nil {
+		reservedIP, _, err := c.vpcService.GetSubnetReservedIP(c.vpcService.NewGetSubnetReservedIPOptions(subnetID, ref))
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve reserved ip %v on subnet %v: %v", ref, subnetID, err)
 		}
+		return *reservedIP.ID, nil
 	}
 
-	// Check if retrieved all IDs
-	if len(securityGroupNames) == len(SecurityGroupIdentityList) {
-		return SecurityGroupIdentityList, nil
+	existing, err := c.getReservedIPByAddress(subnetID, ref)
+	if err != nil {
+		return "", err
 	}
+	if existing != nil {
+		return *existing.ID, nil
+	}
+
+	createOptions := c.vpcService.NewCreateSubnetReservedIPOptions(subnetID)
+	createOptions.SetName(reservedIPName(ref))
+	createOptions.SetAddress(ref)
+	createOptions.SetAutoDelete(true)
 
-	return nil, fmt.Errorf("could not retrieve security group ids of names: %v", securityGroupMap)
+	reservedIP, _, err := c.vpcService.CreateSubnetReservedIP(createOptions)
+	if err != nil {
+		return "", fmt.Errorf("could not reserve ip %v on subnet %v: %v", ref, subnetID, err)
+	}
 
+	return *reservedIP.ID, nil
 }
 
-// GetDedicatedHostByName retrieves Dedicated Hosts info
-func (c *ibmCloudClient) GetDedicatedHostByName(dedicatedHostName string, resourceGroupID string, zoneName string) (string, error) {
-	// Initialize List Dedicated Hosts Options
-	dedicatedHostOptions := c.vpcService.NewListDedicatedHostsOptions()
+// listReservedIPs drains every page of reserved IPs on subnetID.
+func (c *ibmCloudClient) listReservedIPs(subnetID string) ([]vpcv1.ReservedIP, error) {
+	reservedIPs, err := resolver.FollowPages(func(start *string) ([]vpcv1.ReservedIP, *string, error) {
+		listOptions := c.vpcService.NewListSubnetReservedIpsOptions(subnetID)
+		if start != nil {
+			listOptions.SetStart(*start)
+		}
 
-	// Set Resource Group ID
-	dedicatedHostOptions.SetResourceGroupID(resourceGroupID)
+		reservedIPList, _, err := c.vpcService.ListSubnetReservedIps(listOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reservedIPList == nil {
+			return nil, nil, nil
+		}
+
+		var next *string
+		if reservedIPList.Next != nil {
+			next = reservedIPList.Next.Href
+		}
+		return reservedIPList.ReservedIps, next, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list reserved ips on subnet %v: %v", subnetID, err)
+	}
 
-	// Set Zone
-	dedicatedHostOptions.SetZoneName(zoneName)
+	return reservedIPs, nil
+}
 
-	// Get a list of all Dedicated Hosts
-	dedicatedHosts, _, err := c.vpcService.ListDedicatedHosts(dedicatedHostOptions)
+// getReservedIPByAddress returns the reserved IP bound to address on
+// subnetID, or nil if none exists. EnsureReservedIP uses this to reuse a
+// reserved IP it created on an earlier, partially-failed InstanceCreate
+// instead of retrying CreateSubnetReservedIP and getting back a 409 for the
+// address already being reserved.
+func (c *ibmCloudClient) getReservedIPByAddress(subnetID string, address string) (*vpcv1.ReservedIP, error) {
+	reservedIPs, err := c.listReservedIPs(subnetID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if dedicatedHosts != nil && len(dedicatedHosts.DedicatedHosts) > 0 {
-		for _, eachDedicatedHost := range dedicatedHosts.DedicatedHosts {
-			if *eachDedicatedHost.Name == dedicatedHostName {
-				// return Dedicated Host ID
-				return *eachDedicatedHost.ID, nil
-			}
+	for _, reservedIP := range reservedIPs {
+		if *reservedIP.Address == address {
+			return &reservedIP, nil
 		}
 	}
 
-	return "", fmt.Errorf("could not retrieve dedicated host id of name: %v", dedicatedHostName)
+	return nil, nil
+}
+
+// ReleaseReservedIP deletes the reserved IP bound to address on subnetID. It
+// is exposed for callers that manage a reserved IP's lifecycle independently
+// of the instance using it; EnsureReservedIP otherwise relies on AutoDelete
+// to clean up the reserved IPs it creates itself.
+func (c *ibmCloudClient) ReleaseReservedIP(subnetID string, address string) error {
+	reservedIPs, err := c.listReservedIPs(subnetID)
+	if err != nil {
+		return err
+	}
+
+	for _, reservedIP := range reservedIPs {
+		if *reservedIP.Address == address {
+			_, err := c.vpcService.DeleteSubnetReservedIP(c.vpcService.NewDeleteSubnetReservedIPOptions(subnetID, *reservedIP.ID))
+			return err
+		}
+	}
+
+	return fmt.Errorf("could not retrieve reserved ip of address: %v", address)
+}
+
+// EnsureFloatingIP allocates a floating IP named name in zoneName and binds
+// it to targetID, a network interface ID. If a floating IP named name
+// already exists it is reused instead of re-created, so a reconcile retry
+// after a partial InstanceCreate does not fail with a 409 on the
+// already-allocated name.
+func (c *ibmCloudClient) EnsureFloatingIP(name string, zoneName string, targetID string) (*vpcv1.FloatingIP, error) {
+	existing, err := c.getFloatingIPByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	prototype := &vpcv1.FloatingIPPrototypeFloatingIPByTarget{
+		Name: &name,
+		Zone: &vpcv1.ZoneIdentity{
+			Name: &zoneName,
+		},
+		Target: &vpcv1.FloatingIPByTargetNetworkInterfaceIdentity{
+			ID: &targetID,
+		},
+	}
+
+	floatingIP, _, err := c.vpcService.CreateFloatingIP(c.vpcService.NewCreateFloatingIPOptions(prototype))
+	if err != nil {
+		return nil, fmt.Errorf("could not allocate floating ip %v: %v", name, err)
+	}
+
+	return floatingIP, nil
+}
+
+// getFloatingIPByName returns the floating IP named name, or nil if none
+// exists.
+func (c *ibmCloudClient) getFloatingIPByName(name string) (*vpcv1.FloatingIP, error) {
+	listOptions := c.vpcService.NewListFloatingIpsOptions()
+	listOptions.SetName(name)
+
+	floatingIPs, _, err := c.vpcService.ListFloatingIps(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not list floating ips named %v: %v", name, err)
+	}
+	if floatingIPs == nil || len(floatingIPs.FloatingIps) == 0 {
+		return nil, nil
+	}
+
+	return &floatingIPs.FloatingIps[0], nil
+}
+
+// DeleteFloatingIP releases a floating IP, detaching it from whatever it is
+// currently bound to.
+func (c *ibmCloudClient) DeleteFloatingIP(floatingIPID string) error {
+	_, err := c.vpcService.DeleteFloatingIP(c.vpcService.NewDeleteFloatingIPOptions(floatingIPID))
+	return err
+}
+
+// waitForInstanceRunning polls the instance until it reaches the "running"
+// status or a terminal failure status, since a floating IP cannot be bound
+// to a network interface until the instance behind it is up. It gives up
+// after pollTimeout so an instance stuck provisioning cannot hang the
+// reconcile forever, and it also stops as soon as ctx is done, so a caller
+// with a shorter reconcile deadline is not held here for the full
+// pollTimeout before it can requeue.
+func (c *ibmCloudClient) waitForInstanceRunning(ctx context.Context, instanceID string) error {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		instance, err := c.InstanceGetByID(instanceID)
+		if err != nil {
+			return err
+		}
+
+		switch *instance.Status {
+		case vpcv1.InstanceStatusRunningConst:
+			return nil
+		case vpcv1.InstanceStatusFailedConst:
+			return fmt.Errorf("instance %v failed to start", instanceID)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for instance %v to reach running", pollTimeout, instanceID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for instance %v to reach running: %w", instanceID, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
 }
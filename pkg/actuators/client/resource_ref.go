@@ -0,0 +1,66 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"regexp"
+	"strings"
+)
+
+// resourceRefKind classifies the form of a value a user supplied to
+// reference a VPC resource (VPC, subnet, security group, ...): a
+// human-assigned name, a resource ID, or a full CRN.
+type resourceRefKind int
+
+const (
+	resourceRefName resourceRefKind = iota
+	resourceRefID
+	resourceRefCRN
+)
+
+// vpcResourceIDPattern matches the "<prefix>-<uuid>" shape IBM Cloud VPC
+// assigns to resource IDs, e.g. "02c7-e21b5318-81e9-4224-aabd-6154f4f5b579".
+// A name of that shape, e.g. "r006-<uuid>", is also a valid RFC1035 label
+// and is classified as an ID rather than a name.
+var vpcResourceIDPattern = regexp.MustCompile(`^[0-9a-z]+-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// classifyResourceRef determines whether ref is a name, an ID, or a CRN so
+// callers can skip the list-then-filter lookup when the user already gave
+// us something we can fetch directly. This is what lets a BYON install
+// reference existing VPC infrastructure that the machine controller has no
+// permission to list.
+func classifyResourceRef(ref string) resourceRefKind {
+	switch {
+	case strings.HasPrefix(ref, "crn:"):
+		return resourceRefCRN
+	case vpcResourceIDPattern.MatchString(ref):
+		return resourceRefID
+	default:
+		return resourceRefName
+	}
+}
+
+// crnResourceID extracts the trailing resource ID segment from a CRN, e.g.
+// "crn:v1:bluemix:public:is:us-south:a/1234::vpc:02c7-e21b..." becomes
+// "02c7-e21b...".
+func crnResourceID(crn string) string {
+	idx := strings.LastIndex(crn, ":")
+	if idx == -1 {
+		return crn
+	}
+	return crn[idx+1:]
+}
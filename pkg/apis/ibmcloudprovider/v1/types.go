@@ -0,0 +1,206 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the provider-specific types embedded in a Machine's
+// spec.providerSpec.value for the IBM Cloud VPC machine actuator.
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IBMCloudMachineProviderSpec is the type that will be embedded in a
+// Machine.Spec.ProviderSpec field for an IBM Cloud VPC virtual server
+// instance. It is used by the IBM Cloud machine actuator to create a
+// single machine instance.
+type IBMCloudMachineProviderSpec struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// UserDataSecret contains a local reference to a secret that contains the
+	// UserData to apply to the instance.
+	UserDataSecret *corev1.LocalObjectReference `json:"userDataSecret,omitempty"`
+
+	// CredentialsSecret is a reference to the secret with IBM Cloud credentials.
+	CredentialsSecret *corev1.LocalObjectReference `json:"credentialsSecret,omitempty"`
+
+	// Credentials selects how the machine controller authenticates to IBM
+	// Cloud IAM. When empty, Credentials.Type defaults to
+	// CredentialsTypeAPIKey and CredentialsSecret is read as a static API key.
+	// +optional
+	Credentials CredentialsSpec `json:"credentials,omitempty"`
+
+	// Region is the IBM Cloud region in which the machine is created.
+	Region string `json:"region"`
+
+	// Zone is the IBM Cloud zone in which the machine is created.
+	Zone string `json:"zone"`
+
+	// ResourceGroup is the name of the resource group under which VPC
+	// resources for the machine will be looked up.
+	ResourceGroup string `json:"resourceGroup"`
+
+	// VPC is the name, ID, or CRN of the VPC in which the machine is created.
+	VPC string `json:"vpc"`
+
+	// Image is the name of the VPC Custom Image to boot the machine from. It
+	// may be left empty when CustomImage is set, in which case the image is
+	// imported from Cloud Object Storage before the machine is created.
+	Image string `json:"image,omitempty"`
+
+	// CustomImage describes how to import a VPC Custom Image from Cloud
+	// Object Storage when Image does not yet reference an existing image.
+	// +optional
+	CustomImage *CustomImageSpec `json:"customImage,omitempty"`
+
+	// Profile is the VPC instance profile (the machine's virtual hardware
+	// template) to use, e.g. "bx2-4x16".
+	Profile string `json:"profile"`
+
+	// PrimaryNetworkInterface is the network interface attached to the
+	// machine as its primary interface.
+	PrimaryNetworkInterface NetworkInterface `json:"primaryNetworkInterface,omitempty"`
+
+	// NetworkInterfaces is the list of additional network interfaces
+	// attached to the machine.
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// DedicatedHost is the name of the dedicated host, or dedicated host
+	// group, the machine should be placed on; it is matched by name only,
+	// not by ID or CRN. When it names a group, IBM Cloud picks the
+	// least-loaded host in that group. Mutually exclusive with
+	// PlacementGroup.
+	DedicatedHost string `json:"dedicatedHost,omitempty"`
+
+	// PlacementGroup is the name of the placement group the machine should
+	// be placed in (matched by name only, not by ID or CRN), giving it
+	// spread or pack anti-affinity
+	// guarantees relative to the group's other instances. Mutually
+	// exclusive with DedicatedHost.
+	// +optional
+	PlacementGroup string `json:"placementGroup,omitempty"`
+
+	// InfrastructureID is the cluster's infrastructure ID, used to tag the
+	// instance as owned by this cluster (kubernetes.io/cluster/<id>:owned)
+	// so it can be found again during reconcile.
+	InfrastructureID string `json:"infrastructureID,omitempty"`
+
+	// Tags is a list of user-defined tags to attach to the instance on
+	// creation, in addition to the cluster-ownership tag.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+}
+
+// NetworkInterface describes a VPC network interface to attach to a machine.
+type NetworkInterface struct {
+	// Subnet is the name, ID, or CRN of the subnet the interface is attached to.
+	Subnet string `json:"subnet"`
+
+	// SecurityGroups is the list of security group names, IDs, or CRNs to
+	// attach to the interface.
+	SecurityGroups []string `json:"securityGroups,omitempty"`
+
+	// AllowIPSpoofing indicates whether source IP spoofing is allowed on the interface.
+	AllowIPSpoofing bool `json:"allowIPSpoofing,omitempty"`
+
+	// ReservedIP is either the ID of an existing reserved IP to bind to this
+	// interface, or an IP address to reserve and bind to it.
+	// +optional
+	ReservedIP string `json:"reservedIP,omitempty"`
+
+	// EnableFloatingIP requests that a floating IP be allocated and bound
+	// to this interface once the instance reaches the running state.
+	// +optional
+	EnableFloatingIP bool `json:"enableFloatingIP,omitempty"`
+}
+
+// CredentialsType identifies an IAM authentication mechanism the machine
+// controller can use in place of a long-lived API key.
+type CredentialsType string
+
+const (
+	// CredentialsTypeAPIKey authenticates with a static IAM API key.
+	// This is the default when Type is left empty.
+	CredentialsTypeAPIKey CredentialsType = "APIKey"
+
+	// CredentialsTypeTrustedProfile exchanges a projected Kubernetes
+	// service-account token for IAM credentials via an IAM trusted profile.
+	CredentialsTypeTrustedProfile CredentialsType = "TrustedProfile"
+
+	// CredentialsTypeInstanceIdentity retrieves an IAM token from the VPC
+	// instance metadata service using the instance's own identity.
+	CredentialsTypeInstanceIdentity CredentialsType = "InstanceIdentity"
+
+	// CredentialsTypeFile reads a static IAM API key from a file mounted on
+	// disk rather than from the secret value passed to the client.
+	CredentialsTypeFile CredentialsType = "File"
+)
+
+// CredentialsSpec configures how the machine controller authenticates to
+// IBM Cloud IAM.
+type CredentialsSpec struct {
+	// Type selects the authentication mechanism. Defaults to
+	// CredentialsTypeAPIKey when empty.
+	// +optional
+	Type CredentialsType `json:"type,omitempty"`
+
+	// TrustedProfileID is the IAM trusted profile to assume when Type is
+	// CredentialsTypeTrustedProfile.
+	// +optional
+	TrustedProfileID string `json:"trustedProfileID,omitempty"`
+}
+
+// CustomImageSpec is the source information needed to import a VPC Custom
+// Image from Cloud Object Storage.
+type CustomImageSpec struct {
+	// Name is the name the imported Custom Image should be created with. If
+	// an image with this name already exists in the resource group, it is
+	// reused instead of importing a new one.
+	Name string `json:"name"`
+
+	// COSObjectURL is the source object store location of the image, in the
+	// form "cos://<bucket>/<object-key>".
+	COSObjectURL string `json:"cosObjectURL"`
+
+	// OperatingSystem is the name of the VPC operating system the image
+	// uses, e.g. "red-hat-enterprise-linux-coreos-stable-amd64".
+	OperatingSystem string `json:"operatingSystem"`
+
+	// EncryptionKeyCRN is the CRN of the Key Protect or Hyper Protect Crypto
+	// Services root key used to encrypt the image, if any.
+	// +optional
+	EncryptionKeyCRN string `json:"encryptionKeyCRN,omitempty"`
+}
+
+// IBMCloudMachineProviderStatus is the type that will be embedded in a
+// Machine.Status.ProviderStatus field.
+type IBMCloudMachineProviderStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// InstanceID is the ID of the instance in IBM Cloud.
+	// +optional
+	InstanceID *string `json:"instanceId,omitempty"`
+
+	// InstanceState is the status of the instance in IBM Cloud.
+	// +optional
+	InstanceState *string `json:"instanceState,omitempty"`
+
+	// Conditions is a set of conditions associated with the Machine.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resolver provides a TTL cache of resolved VPC resource IDs shared
+// across Client instances, with singleflight coalescing so that many
+// concurrent machine creations for the same MachineSet perform only one
+// lookup each instead of one per machine.
+package resolver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Key identifies a single cached resource lookup.
+type Key struct {
+	AccountID       string
+	Region          string
+	ResourceGroupID string
+	Kind            string
+	Name            string
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", k.AccountID, k.Region, k.ResourceGroupID, k.Kind, k.Name)
+}
+
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Cache is a TTL cache of resolved resource IDs. It is safe for concurrent
+// use, and is typically shared across every Client built against the same
+// account so that lookups for common resources (a shared VPC, a subnet
+// referenced by every machine in a MachineSet, ...) are not repeated.
+type Cache struct {
+	ttl   time.Duration
+	mu    sync.RWMutex
+	items map[Key]cacheEntry
+	group singleflight.Group
+}
+
+// NewCache returns a Cache whose entries expire after ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:   ttl,
+		items: make(map[Key]cacheEntry),
+	}
+}
+
+// Get returns the cached value for key, if present and not expired.
+func (c *Cache) Get(key Key) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.items[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// Set stores value for key, resetting its TTL.
+func (c *Cache) Set(key Key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// Invalidate removes a single cached entry, for callers that hit a 404 or
+// 409 against the resolved ID and need to force a fresh lookup next time.
+func (c *Cache) Invalidate(key Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+// InvalidateByName removes every cached entry for the given resource kind
+// and name, regardless of which region or resource group the original
+// lookup used. This is the shape callers need when they only know "this
+// name just 404'd", not which resource group resolved it.
+func (c *Cache) InvalidateByName(kind, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.items {
+		if key.Kind == kind && key.Name == name {
+			delete(c.items, key)
+		}
+	}
+}
+
+// Resolve returns the cached value for key, calling fetch to populate the
+// cache on a miss. Concurrent Resolve calls for the same key coalesce into
+// a single call to fetch.
+func (c *Cache) Resolve(key Key, fetch func() (string, error)) (string, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err, _ := c.group.Do(key.String(), func() (interface{}, error) {
+		if value, ok := c.Get(key); ok {
+			return value, nil
+		}
+
+		value, err := fetch()
+		if err != nil {
+			return "", err
+		}
+
+		c.Set(key, value)
+		return value, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return value.(string), nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import "github.com/IBM/go-sdk-core/v5/core"
+
+// FollowPages drains every page of an IBM Cloud paginated list by
+// repeatedly calling fetch with the "start" cursor extracted from the
+// previous page's "next" link, until no next link is returned. Without
+// this, callers that only read the first page silently truncate at the
+// API's default page size and report "not found" once an account has more
+// than a page of subnets, security groups, and so on.
+func FollowPages[T any](fetch func(start *string) (items []T, next *string, err error)) ([]T, error) {
+	var all []T
+	var start *string
+
+	for {
+		items, next, err := fetch(start)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+
+		if next == nil || *next == "" {
+			return all, nil
+		}
+
+		startToken, err := core.GetQueryParam(next, "start")
+		if err != nil || startToken == nil {
+			return all, nil
+		}
+		start = startToken
+	}
+}